@@ -1,3 +1,4 @@
+//go:build linux
 // +build linux
 
 /*
@@ -19,8 +20,10 @@ limitations under the License.
 package ipvs
 
 import (
+	"context"
 	"fmt"
 	"github.com/vishvananda/netlink"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"net"
 	"syscall"
@@ -28,11 +31,131 @@ import (
 
 type netlinkHandle struct {
 	netlink.Handle
+	isIPv6 bool
 }
 
-// NewNetLinkHandle will crate a new netlinkHandle
-func NewNetLinkHandle() NetLinkHandle {
-	return &netlinkHandle{netlink.Handle{}}
+// NewNetLinkHandle will create a new netlinkHandle. Set isIPv6 so that
+// family-sensitive operations (GetLocalAddresses, GetAllLocalAddressesExcept)
+// only consider addresses of the handle's own family.
+func NewNetLinkHandle(isIPv6 bool) NetLinkHandle {
+	return &netlinkHandle{netlink.Handle{}, isIPv6}
+}
+
+// NetLinkEventKind identifies the kind of change a NetLinkEvent reports.
+type NetLinkEventKind int
+
+const (
+	// AddrAdd is emitted when an address is added to the watched link.
+	AddrAdd NetLinkEventKind = iota
+	// AddrDel is emitted when an address is removed from the watched link.
+	AddrDel
+	// RouteAdd is emitted when a route is added to the local routing table.
+	RouteAdd
+	// RouteDel is emitted when a route is removed from the local routing table.
+	RouteDel
+)
+
+// NetLinkEvent carries a single address or route change observed on the dummy device
+// or the local routing table, so the proxier can run an event-driven partial sync
+// instead of re-reading the full state on every resync.
+type NetLinkEvent struct {
+	Kind      NetLinkEventKind
+	IPNet     *net.IPNet
+	LinkIndex int
+}
+
+// addrEventKind maps an AddrUpdate's NewAddr flag to a NetLinkEventKind.
+func addrEventKind(newAddr bool) NetLinkEventKind {
+	if newAddr {
+		return AddrAdd
+	}
+	return AddrDel
+}
+
+// routeEventKind maps a RouteUpdate's netlink message type to a NetLinkEventKind.
+func routeEventKind(msgType uint16) NetLinkEventKind {
+	if msgType == syscall.RTM_DELROUTE {
+		return RouteDel
+	}
+	return RouteAdd
+}
+
+// sameFamily reports whether ip belongs to the given netlink address family.
+func sameFamily(ip net.IP, family int) bool {
+	if ip == nil {
+		return false
+	}
+	if family == netlink.FAMILY_V6 {
+		return ip.To4() == nil
+	}
+	return ip.To4() != nil
+}
+
+// defaultDummyDevice is the name of the dummy device the IPVS proxier binds service
+// VIPs to (kube-ipvs0). Subscribe watches this device rather than taking a devName
+// argument, matching the proxier's single well-known interface.
+const defaultDummyDevice = "kube-ipvs0"
+
+// Subscribe streams address changes on the dummy device's link and local-table route
+// changes on that same link until ctx is canceled, filtered to the handle's own
+// address family. It lets the proxier rebind a VIP stripped by an external actor
+// (NetworkManager, systemd-networkd) within milliseconds, and skip full
+// GetLocalAddresses scans on syncs where nothing changed.
+func (h *netlinkHandle) Subscribe(ctx context.Context) (<-chan NetLinkEvent, error) {
+	dev, err := h.LinkByName(defaultDummyDevice)
+	if err != nil {
+		return nil, fmt.Errorf("error get interface: %s, err: %v", defaultDummyDevice, err)
+	}
+	linkIndex := dev.Attrs().Index
+
+	family := netlink.FAMILY_V4
+	if h.isIPv6 {
+		family = netlink.FAMILY_V6
+	}
+
+	events := make(chan NetLinkEvent, 64)
+
+	addrUpdates := make(chan netlink.AddrUpdate, 64)
+	if err := netlink.AddrSubscribeWithOptions(addrUpdates, ctx.Done(), netlink.AddrSubscribeOptions{}); err != nil {
+		return nil, fmt.Errorf("error subscribing to address updates: %v", err)
+	}
+
+	routeUpdates := make(chan netlink.RouteUpdate, 64)
+	if err := netlink.RouteSubscribeWithOptions(routeUpdates, ctx.Done(), netlink.RouteSubscribeOptions{}); err != nil {
+		return nil, fmt.Errorf("error subscribing to route updates: %v", err)
+	}
+
+	go func() {
+		defer close(events)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update, ok := <-addrUpdates:
+				if !ok {
+					return
+				}
+				if update.LinkIndex != linkIndex || !sameFamily(update.LinkAddress.IP, family) {
+					continue
+				}
+				events <- NetLinkEvent{Kind: addrEventKind(update.NewAddr), IPNet: &update.LinkAddress, LinkIndex: update.LinkIndex}
+			case update, ok := <-routeUpdates:
+				if !ok {
+					return
+				}
+				var dstIP net.IP
+				if update.Route.Dst != nil {
+					dstIP = update.Route.Dst.IP
+				}
+				if update.Route.LinkIndex != linkIndex || update.Route.Table != syscall.RT_TABLE_LOCAL || !sameFamily(dstIP, family) {
+					continue
+				}
+				events <- NetLinkEvent{Kind: routeEventKind(update.Type), IPNet: update.Route.Dst, LinkIndex: update.Route.LinkIndex}
+			}
+		}
+	}()
+
+	return events, nil
 }
 
 // EnsureAddressBind checks if address is bound to the interface and, if not, binds it. If the address is already bound, return true.
@@ -71,6 +194,101 @@ func (h *netlinkHandle) UnbindAddress(address, devName string) error {
 	return nil
 }
 
+// EnsureAddressesBind checks which of addresses are already bound to devName and binds
+// the rest, using a single netlink socket for the whole batch instead of one per
+// address. It returns the subset of addresses that were already bound.
+func (h *netlinkHandle) EnsureAddressesBind(addresses []string, devName string) (existing sets.String, err error) {
+	nlHandle, err := netlink.NewHandle()
+	if err != nil {
+		return nil, fmt.Errorf("error creating netlink handle: %v", err)
+	}
+	defer nlHandle.Delete()
+
+	dev, err := nlHandle.LinkByName(devName)
+	if err != nil {
+		return nil, fmt.Errorf("error get interface: %s, err: %v", devName, err)
+	}
+
+	existing = sets.NewString()
+	var errs []error
+	for _, address := range addresses {
+		addr := net.ParseIP(address)
+		if addr == nil {
+			errs = append(errs, fmt.Errorf("error parse ip address: %s", address))
+			continue
+		}
+		if err := nlHandle.AddrAdd(dev, &netlink.Addr{IPNet: netlink.NewIPNet(addr)}); err != nil {
+			// "EEXIST" will be returned if the address is already bound to device
+			if err == syscall.Errno(syscall.EEXIST) {
+				existing.Insert(address)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("error bind address: %s to interface: %s, err: %v", address, devName, err))
+		}
+	}
+	if len(errs) > 0 {
+		return existing, fmt.Errorf("error binding addresses to interface %s: %v", devName, utilerrors.NewAggregate(errs))
+	}
+	return existing, nil
+}
+
+// UnbindAddresses unbinds addresses from devName, using a single netlink socket for the
+// whole batch instead of one per address.
+func (h *netlinkHandle) UnbindAddresses(addresses []string, devName string) error {
+	nlHandle, err := netlink.NewHandle()
+	if err != nil {
+		return fmt.Errorf("error creating netlink handle: %v", err)
+	}
+	defer nlHandle.Delete()
+
+	dev, err := nlHandle.LinkByName(devName)
+	if err != nil {
+		return fmt.Errorf("error get interface: %s, err: %v", devName, err)
+	}
+
+	var errs []error
+	for _, address := range addresses {
+		addr := net.ParseIP(address)
+		if addr == nil {
+			errs = append(errs, fmt.Errorf("error parse ip address: %s", address))
+			continue
+		}
+		if err := nlHandle.AddrDel(dev, &netlink.Addr{IPNet: netlink.NewIPNet(addr)}); err != nil {
+			errs = append(errs, fmt.Errorf("error unbind address: %s from interface: %s, err: %v", address, devName, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error unbinding addresses from interface %s: %v", devName, utilerrors.NewAggregate(errs))
+	}
+	return nil
+}
+
+// ListBoundAddresses returns all addresses currently bound to devName, of the handle's
+// own family, so the proxier can diff against the desired state once per sync instead
+// of probing each VIP individually.
+func (h *netlinkHandle) ListBoundAddresses(devName string) (sets.String, error) {
+	dev, err := h.LinkByName(devName)
+	if err != nil {
+		return nil, fmt.Errorf("error get interface: %s, err: %v", devName, err)
+	}
+
+	family := netlink.FAMILY_V4
+	if h.isIPv6 {
+		family = netlink.FAMILY_V6
+	}
+
+	addrs, err := h.AddrList(dev, family)
+	if err != nil {
+		return nil, fmt.Errorf("error list addresses on interface: %s, err: %v", devName, err)
+	}
+
+	res := sets.NewString()
+	for _, addr := range addrs {
+		res.Insert(addr.IP.String())
+	}
+	return res, nil
+}
+
 // EnsureDummyDevice is part of interface
 func (h *netlinkHandle) EnsureDummyDevice(devName string) (bool, error) {
 	_, err := h.LinkByName(devName)
@@ -96,7 +314,253 @@ func (h *netlinkHandle) DeleteDummyDevice(devName string) error {
 	}
 	return h.LinkDel(dummy)
 }
+
+// EnsureVXLANDevice checks if the named VXLAN device exists and matches the requested
+// VNI/local/group/port and, if not, (re)creates it. If a matching device already
+// exists, return true.
+func (h *netlinkHandle) EnsureVXLANDevice(name string, vni uint32, local net.IP, group net.IP, port uint16) (bool, error) {
+	link, err := h.LinkByName(name)
+	if err == nil {
+		vxlan, ok := link.(*netlink.Vxlan)
+		if !ok {
+			return false, fmt.Errorf("expect vxlan device, got device type: %s", link.Type())
+		}
+		if vxlan.VxlanId == int(vni) && vxlan.Port == int(port) && vxlan.Group.Equal(group) && vxlan.SrcAddr.Equal(local) {
+			return true, nil
+		}
+		// requested parameters don't match the existing device, tear it down and recreate it
+		if err := h.LinkDel(vxlan); err != nil {
+			return false, fmt.Errorf("error deleting stale vxlan device: %s, err: %v", name, err)
+		}
+	}
+
+	vxlan := &netlink.Vxlan{
+		LinkAttrs: netlink.LinkAttrs{Name: name},
+		VxlanId:   int(vni),
+		Port:      int(port),
+		SrcAddr:   local,
+		Group:     group,
+	}
+	return false, h.LinkAdd(vxlan)
+}
+
+// DeleteVXLANDevice deletes the given VXLAN device by name.
+func (h *netlinkHandle) DeleteVXLANDevice(name string) error {
+	link, err := h.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("error deleting a non-exist vxlan device: %s", name)
+	}
+	vxlan, ok := link.(*netlink.Vxlan)
+	if !ok {
+		return fmt.Errorf("expect vxlan device, got device type: %s", link.Type())
+	}
+	return h.LinkDel(vxlan)
+}
+
+// ProxyRouteRule wraps the subset of netlink.Rule fields the proxier cares about for
+// policy routing, e.g. steering masqueraded service traffic to a dedicated table keyed
+// on fwmark for DSR or source-hash load balancing.
+type ProxyRouteRule struct {
+	Src      string
+	Dst      string
+	Table    int
+	Mark     int
+	Priority int
+	IifName  string
+	OifName  string
+}
+
+func (r *ProxyRouteRule) toNetlinkRule() (*netlink.Rule, error) {
+	rule := netlink.NewRule()
+	rule.Table = r.Table
+	rule.Mark = r.Mark
+	rule.Priority = r.Priority
+	rule.IifName = r.IifName
+	rule.OifName = r.OifName
+	if len(r.Src) != 0 {
+		_, src, err := net.ParseCIDR(r.Src)
+		if err != nil {
+			return nil, fmt.Errorf("error parse src: %s, err: %v", r.Src, err)
+		}
+		rule.Src = src
+	}
+	if len(r.Dst) != 0 {
+		_, dst, err := net.ParseCIDR(r.Dst)
+		if err != nil {
+			return nil, fmt.Errorf("error parse dst: %s, err: %v", r.Dst, err)
+		}
+		rule.Dst = dst
+	}
+	return rule, nil
+}
+
+func fromNetlinkRule(rule netlink.Rule) ProxyRouteRule {
+	r := ProxyRouteRule{
+		Table:    rule.Table,
+		Mark:     rule.Mark,
+		Priority: rule.Priority,
+		IifName:  rule.IifName,
+		OifName:  rule.OifName,
+	}
+	if rule.Src != nil {
+		r.Src = rule.Src.String()
+	}
+	if rule.Dst != nil {
+		r.Dst = rule.Dst.String()
+	}
+	return r
+}
+
+// EnsureRule checks if the given policy routing rule exists and, if not, adds it. If
+// the rule already exists, return true.
+func (h *netlinkHandle) EnsureRule(rule *ProxyRouteRule) (bool, error) {
+	nlRule, err := rule.toNetlinkRule()
+	if err != nil {
+		return false, err
+	}
+	if err := h.RuleAdd(nlRule); err != nil {
+		if err == syscall.Errno(syscall.EEXIST) {
+			return true, nil
+		}
+		return false, fmt.Errorf("error add rule: %+v, err: %v", rule, err)
+	}
+	return false, nil
+}
+
+// DeleteRule deletes the given policy routing rule.
+func (h *netlinkHandle) DeleteRule(rule *ProxyRouteRule) error {
+	nlRule, err := rule.toNetlinkRule()
+	if err != nil {
+		return err
+	}
+	if err := h.RuleDel(nlRule); err != nil {
+		return fmt.Errorf("error delete rule: %+v, err: %v", rule, err)
+	}
+	return nil
+}
+
+// ListRules lists the policy routing rules installed for the given address family.
+func (h *netlinkHandle) ListRules(family int) ([]ProxyRouteRule, error) {
+	nlRules, err := h.RuleList(family)
+	if err != nil {
+		return nil, fmt.Errorf("error list rules, err: %v", err)
+	}
+	rules := make([]ProxyRouteRule, 0, len(nlRules))
+	for _, nlRule := range nlRules {
+		rules = append(rules, fromNetlinkRule(nlRule))
+	}
+	return rules, nil
+}
+
+// EnsureNeighbor adds or updates a neighbor (ARP/NDP) entry pinning hwAddr to ip on
+// devName, in the given state (NUD_PERMANENT when state is 0). This is used in IPVS direct-routing mode where real-server MACs must
+// be pinned on the director, and to suppress gratuitous ARP flaps when the same VIP is
+// briefly bound on multiple nodes during failover.
+func (h *netlinkHandle) EnsureNeighbor(ip net.IP, hwAddr net.HardwareAddr, devName string, state int) error {
+	dev, err := h.LinkByName(devName)
+	if err != nil {
+		return fmt.Errorf("error get interface: %s, err: %v", devName, err)
+	}
+	if state == 0 {
+		state = netlink.NUD_PERMANENT
+	}
+	family := netlink.FAMILY_V4
+	if ip.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+	neigh := &netlink.Neigh{
+		LinkIndex:    dev.Attrs().Index,
+		Family:       family,
+		State:        state,
+		Type:         syscall.RTN_UNICAST,
+		IP:           ip,
+		HardwareAddr: hwAddr,
+	}
+	if err := h.NeighAdd(neigh); err != nil {
+		// "EEXIST" will be returned if an entry for ip already exists on the device, replace it
+		if err != syscall.Errno(syscall.EEXIST) {
+			return fmt.Errorf("error add neighbor: %s on interface: %s, err: %v", ip, devName, err)
+		}
+		if err := h.NeighSet(neigh); err != nil {
+			return fmt.Errorf("error update neighbor: %s on interface: %s, err: %v", ip, devName, err)
+		}
+	}
+	return nil
+}
+
+// DeleteNeighbor deletes the neighbor entry for ip on devName.
+func (h *netlinkHandle) DeleteNeighbor(ip net.IP, devName string) error {
+	dev, err := h.LinkByName(devName)
+	if err != nil {
+		return fmt.Errorf("error get interface: %s, err: %v", devName, err)
+	}
+	family := netlink.FAMILY_V4
+	if ip.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+	neigh := &netlink.Neigh{
+		LinkIndex: dev.Attrs().Index,
+		Family:    family,
+		IP:        ip,
+	}
+	if err := h.NeighDel(neigh); err != nil {
+		return fmt.Errorf("error delete neighbor: %s on interface: %s, err: %v", ip, devName, err)
+	}
+	return nil
+}
+
+// ProxyNeighbor wraps the subset of netlink.Neigh fields the proxier cares about,
+// paralleling ProxyRouteRule so neither rules nor neighbors leak the netlink package's
+// types through NetLinkHandle.
+type ProxyNeighbor struct {
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+	State        int
+}
+
+func fromNetlinkNeigh(neigh netlink.Neigh) ProxyNeighbor {
+	return ProxyNeighbor{
+		IP:           neigh.IP,
+		HardwareAddr: neigh.HardwareAddr,
+		State:        neigh.State,
+	}
+}
+
+// ListNeighbors lists the neighbor entries of the given family on devName, for the
+// proxier to reconcile against the set of real-server endpoints it expects to be pinned.
+func (h *netlinkHandle) ListNeighbors(devName string, family int) ([]ProxyNeighbor, error) {
+	dev, err := h.LinkByName(devName)
+	if err != nil {
+		return nil, fmt.Errorf("error get interface: %s, err: %v", devName, err)
+	}
+	nlNeighs, err := h.NeighList(dev.Attrs().Index, family)
+	if err != nil {
+		return nil, fmt.Errorf("error list neighbors on interface: %s, err: %v", devName, err)
+	}
+	neighs := make([]ProxyNeighbor, 0, len(nlNeighs))
+	for _, nlNeigh := range nlNeighs {
+		neighs = append(neighs, fromNetlinkNeigh(nlNeigh))
+	}
+	return neighs, nil
+}
+
+// GetLocalAddresses returns all local addresses of the handle's own family (IPv4 or
+// IPv6) that are bound to filterDev, or to any device if filterDev is empty.
 func (h *netlinkHandle) GetLocalAddresses(filterDev string) (sets.String, error) {
+	return h.getLocalAddresses(filterDev, "")
+}
+
+// GetAllLocalAddressesExcept returns all local addresses of the handle's own family
+// that are not bound to devName. This lets the proxier distinguish addresses it owns
+// on its dummy device from other local addresses of the same family that must not be
+// swept into its bookkeeping.
+func (h *netlinkHandle) GetAllLocalAddressesExcept(devName string) (sets.String, error) {
+	return h.getLocalAddresses("", devName)
+}
+
+// getLocalAddresses lists local-table routes, optionally restricted to filterDev or
+// excluding exceptDev, and returns the source addresses that match the handle's family.
+func (h *netlinkHandle) getLocalAddresses(filterDev, exceptDev string) (sets.String, error) {
 	linkIndex := -1
 	if len(filterDev) != 0 {
 		link, err := h.LinkByName(filterDev)
@@ -106,6 +570,11 @@ func (h *netlinkHandle) GetLocalAddresses(filterDev string) (sets.String, error)
 		linkIndex = link.Attrs().Index
 	}
 
+	family := netlink.FAMILY_V4
+	if h.isIPv6 {
+		family = netlink.FAMILY_V6
+	}
+
 	routeFilter := &netlink.Route{
 		Table:    syscall.RT_TABLE_LOCAL,
 		Type:     syscall.RTN_LOCAL,
@@ -119,15 +588,29 @@ func (h *netlinkHandle) GetLocalAddresses(filterDev string) (sets.String, error)
 		filterMask |= netlink.RT_FILTER_OIF
 	}
 
-	routes, err := h.RouteListFiltered(netlink.FAMILY_ALL, routeFilter, filterMask)
+	routes, err := h.RouteListFiltered(family, routeFilter, filterMask)
 	if err != nil {
 		return nil, fmt.Errorf("error list route table, err: %v", err)
 	}
+
+	var exceptLinkIndex int
+	if len(exceptDev) != 0 {
+		link, err := h.LinkByName(exceptDev)
+		if err != nil {
+			return nil, fmt.Errorf("error get except device %s, err: %v", exceptDev, err)
+		}
+		exceptLinkIndex = link.Attrs().Index
+	}
+
 	res := sets.NewString()
 	for _, route := range routes {
-		if route.Src != nil {
-			res.Insert(route.Src.String())
+		if route.Src == nil {
+			continue
+		}
+		if len(exceptDev) != 0 && route.LinkIndex == exceptLinkIndex {
+			continue
 		}
+		res.Insert(route.Src.String())
 	}
 	return res, nil
 }
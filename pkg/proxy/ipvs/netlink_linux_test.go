@@ -0,0 +1,89 @@
+//go:build linux
+// +build linux
+
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvs
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestProxyRouteRuleRoundTrip(t *testing.T) {
+	cases := []ProxyRouteRule{
+		{Table: 100, Mark: 0x4000, Priority: 32765, IifName: "", OifName: ""},
+		{Src: "10.0.0.0/24", Dst: "192.168.1.1/32", Table: 200, Mark: 1, Priority: 1, IifName: "eth0", OifName: "kube-ipvs0"},
+	}
+	for _, c := range cases {
+		nlRule, err := c.toNetlinkRule()
+		if err != nil {
+			t.Fatalf("toNetlinkRule(%+v) returned error: %v", c, err)
+		}
+		got := fromNetlinkRule(*nlRule)
+		if got != c {
+			t.Errorf("round trip mismatch: got %+v, want %+v", got, c)
+		}
+	}
+}
+
+func TestProxyRouteRuleInvalidCIDR(t *testing.T) {
+	r := ProxyRouteRule{Src: "not-a-cidr"}
+	if _, err := r.toNetlinkRule(); err == nil {
+		t.Errorf("expected error for invalid src CIDR, got nil")
+	}
+}
+
+func TestAddrEventKind(t *testing.T) {
+	if got := addrEventKind(true); got != AddrAdd {
+		t.Errorf("addrEventKind(true) = %v, want AddrAdd", got)
+	}
+	if got := addrEventKind(false); got != AddrDel {
+		t.Errorf("addrEventKind(false) = %v, want AddrDel", got)
+	}
+}
+
+func TestRouteEventKind(t *testing.T) {
+	if got := routeEventKind(syscall.RTM_DELROUTE); got != RouteDel {
+		t.Errorf("routeEventKind(RTM_DELROUTE) = %v, want RouteDel", got)
+	}
+	if got := routeEventKind(syscall.RTM_NEWROUTE); got != RouteAdd {
+		t.Errorf("routeEventKind(RTM_NEWROUTE) = %v, want RouteAdd", got)
+	}
+}
+
+func TestSameFamily(t *testing.T) {
+	cases := []struct {
+		ip     net.IP
+		family int
+		want   bool
+	}{
+		{net.ParseIP("10.0.0.1"), netlink.FAMILY_V4, true},
+		{net.ParseIP("10.0.0.1"), netlink.FAMILY_V6, false},
+		{net.ParseIP("fd00::1"), netlink.FAMILY_V6, true},
+		{net.ParseIP("fd00::1"), netlink.FAMILY_V4, false},
+		{nil, netlink.FAMILY_V4, false},
+	}
+	for _, c := range cases {
+		if got := sameFamily(c.ip, c.family); got != c.want {
+			t.Errorf("sameFamily(%v, %d) = %v, want %v", c.ip, c.family, got, c.want)
+		}
+	}
+}
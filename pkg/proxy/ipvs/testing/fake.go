@@ -0,0 +1,266 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing
+
+import (
+	"context"
+	"net"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/kubernetes/pkg/proxy/ipvs"
+)
+
+// FakeVXLANDevice records the parameters a VXLAN device was created with.
+type FakeVXLANDevice struct {
+	VNI   uint32
+	Local net.IP
+	Group net.IP
+	Port  uint16
+}
+
+// FakeNetlinkHandle mock implementation of NetLinkHandle
+type FakeNetlinkHandle struct {
+	LocalAddresses map[string][]string // key is device name, value is a list of addresses
+	VXLANDevices   map[string]FakeVXLANDevice
+	Rules          []ipvs.ProxyRouteRule
+	Neighbors      map[string][]ipvs.ProxyNeighbor // key is device name
+	Events         chan ipvs.NetLinkEvent          // tests can push fake events onto this channel
+	isIPv6         bool
+}
+
+// NewFakeNetlinkHandle will create a new FakeNetlinkHandle
+func NewFakeNetlinkHandle(isIPv6 bool) *FakeNetlinkHandle {
+	fake := &FakeNetlinkHandle{isIPv6: isIPv6}
+	fake.LocalAddresses = make(map[string][]string)
+	fake.VXLANDevices = make(map[string]FakeVXLANDevice)
+	fake.Neighbors = make(map[string][]ipvs.ProxyNeighbor)
+	fake.Events = make(chan ipvs.NetLinkEvent)
+	return fake
+}
+
+// EnsureAddressBind checks if address is bound to the interface and, if not, binds it.  If the address is already bound, return true.
+func (h *FakeNetlinkHandle) EnsureAddressBind(address, devName string) (exist bool, err error) {
+	addrs, ok := h.LocalAddresses[devName]
+	if !ok {
+		h.LocalAddresses[devName] = make([]string, 0)
+	}
+	for _, addr := range addrs {
+		if addr == address {
+			// already exist
+			return true, nil
+		}
+	}
+	h.LocalAddresses[devName] = append(h.LocalAddresses[devName], address)
+	return false, nil
+}
+
+// UnbindAddress unbind address from the interface
+func (h *FakeNetlinkHandle) UnbindAddress(address, devName string) error {
+	addrs, ok := h.LocalAddresses[devName]
+	if ok {
+		for i, addr := range addrs {
+			if addr == address {
+				h.LocalAddresses[devName] = append(h.LocalAddresses[devName][:i], h.LocalAddresses[devName][i+1:]...)
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// EnsureAddressesBind is part of NetLinkHandle
+func (h *FakeNetlinkHandle) EnsureAddressesBind(addresses []string, devName string) (existing sets.String, err error) {
+	existing = sets.NewString()
+	for _, address := range addresses {
+		exist, err := h.EnsureAddressBind(address, devName)
+		if err != nil {
+			return existing, err
+		}
+		if exist {
+			existing.Insert(address)
+		}
+	}
+	return existing, nil
+}
+
+// UnbindAddresses is part of NetLinkHandle
+func (h *FakeNetlinkHandle) UnbindAddresses(addresses []string, devName string) error {
+	for _, address := range addresses {
+		if err := h.UnbindAddress(address, devName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListBoundAddresses is part of NetLinkHandle
+func (h *FakeNetlinkHandle) ListBoundAddresses(devName string) (sets.String, error) {
+	return h.getLocalAddresses(devName, "")
+}
+
+// EnsureDummyDevice is part of NetLinkHandle
+func (h *FakeNetlinkHandle) EnsureDummyDevice(devName string) (bool, error) {
+	_, ok := h.LocalAddresses[devName]
+	if ok {
+		return true, nil
+	}
+	h.LocalAddresses[devName] = make([]string, 0)
+	return false, nil
+}
+
+// DeleteDummyDevice is part of NetLinkHandle
+func (h *FakeNetlinkHandle) DeleteDummyDevice(devName string) error {
+	delete(h.LocalAddresses, devName)
+	return nil
+}
+
+// GetLocalAddresses is part of NetLinkHandle
+func (h *FakeNetlinkHandle) GetLocalAddresses(devName string) (sets.String, error) {
+	return h.getLocalAddresses(devName, "")
+}
+
+// GetAllLocalAddressesExcept is part of NetLinkHandle
+func (h *FakeNetlinkHandle) GetAllLocalAddressesExcept(devName string) (sets.String, error) {
+	return h.getLocalAddresses("", devName)
+}
+
+func (h *FakeNetlinkHandle) getLocalAddresses(filterDev, exceptDev string) (sets.String, error) {
+	// only addresses of the handle's own family are returned
+	sameFamily := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		return ip != nil && h.isIPv6 == (ip.To4() == nil)
+	}
+	res := sets.NewString()
+	if len(filterDev) != 0 {
+		for _, addr := range h.LocalAddresses[filterDev] {
+			if sameFamily(addr) {
+				res.Insert(addr)
+			}
+		}
+		return res, nil
+	}
+	for dev, addrs := range h.LocalAddresses {
+		if dev == exceptDev {
+			continue
+		}
+		for _, addr := range addrs {
+			if sameFamily(addr) {
+				res.Insert(addr)
+			}
+		}
+	}
+	return res, nil
+}
+
+// EnsureVXLANDevice is part of NetLinkHandle
+func (h *FakeNetlinkHandle) EnsureVXLANDevice(name string, vni uint32, local net.IP, group net.IP, port uint16) (bool, error) {
+	existing, ok := h.VXLANDevices[name]
+	if ok && existing.VNI == vni && existing.Port == port && existing.Group.Equal(group) && existing.Local.Equal(local) {
+		return true, nil
+	}
+	h.VXLANDevices[name] = FakeVXLANDevice{VNI: vni, Local: local, Group: group, Port: port}
+	return false, nil
+}
+
+// DeleteVXLANDevice is part of NetLinkHandle
+func (h *FakeNetlinkHandle) DeleteVXLANDevice(name string) error {
+	delete(h.VXLANDevices, name)
+	return nil
+}
+
+// EnsureRule is part of NetLinkHandle
+func (h *FakeNetlinkHandle) EnsureRule(rule *ipvs.ProxyRouteRule) (bool, error) {
+	for _, r := range h.Rules {
+		if r == *rule {
+			return true, nil
+		}
+	}
+	h.Rules = append(h.Rules, *rule)
+	return false, nil
+}
+
+// DeleteRule is part of NetLinkHandle
+func (h *FakeNetlinkHandle) DeleteRule(rule *ipvs.ProxyRouteRule) error {
+	for i, r := range h.Rules {
+		if r == *rule {
+			h.Rules = append(h.Rules[:i], h.Rules[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// ListRules is part of NetLinkHandle
+func (h *FakeNetlinkHandle) ListRules(family int) ([]ipvs.ProxyRouteRule, error) {
+	rules := make([]ipvs.ProxyRouteRule, len(h.Rules))
+	copy(rules, h.Rules)
+	return rules, nil
+}
+
+// EnsureNeighbor is part of NetLinkHandle
+func (h *FakeNetlinkHandle) EnsureNeighbor(ip net.IP, hwAddr net.HardwareAddr, devName string, state int) error {
+	neighs := h.Neighbors[devName]
+	for i, n := range neighs {
+		if n.IP.Equal(ip) {
+			neighs[i].HardwareAddr = hwAddr
+			neighs[i].State = state
+			return nil
+		}
+	}
+	h.Neighbors[devName] = append(neighs, ipvs.ProxyNeighbor{IP: ip, HardwareAddr: hwAddr, State: state})
+	return nil
+}
+
+// DeleteNeighbor is part of NetLinkHandle
+func (h *FakeNetlinkHandle) DeleteNeighbor(ip net.IP, devName string) error {
+	neighs := h.Neighbors[devName]
+	for i, n := range neighs {
+		if n.IP.Equal(ip) {
+			h.Neighbors[devName] = append(neighs[:i], neighs[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// ListNeighbors is part of NetLinkHandle
+func (h *FakeNetlinkHandle) ListNeighbors(devName string, family int) ([]ipvs.ProxyNeighbor, error) {
+	neighs := make([]ipvs.ProxyNeighbor, len(h.Neighbors[devName]))
+	copy(neighs, h.Neighbors[devName])
+	return neighs, nil
+}
+
+// Subscribe is part of NetLinkHandle. It forwards whatever the test pushes onto
+// h.Events until ctx is canceled.
+func (h *FakeNetlinkHandle) Subscribe(ctx context.Context) (<-chan ipvs.NetLinkEvent, error) {
+	out := make(chan ipvs.NetLinkEvent)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-h.Events:
+				if !ok {
+					return
+				}
+				out <- ev
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testing
+
+import (
+	"testing"
+)
+
+func TestFakeGetLocalAddresses(t *testing.T) {
+	fake := NewFakeNetlinkHandle(false)
+	fake.LocalAddresses["kube-ipvs0"] = []string{"1.2.3.4", "1.2.3.5"}
+	fake.LocalAddresses["eth0"] = []string{"10.0.0.1"}
+
+	addrs, err := fake.GetLocalAddresses("kube-ipvs0")
+	if err != nil {
+		t.Fatalf("GetLocalAddresses returned error: %v", err)
+	}
+	if !addrs.HasAll("1.2.3.4", "1.2.3.5") || addrs.Len() != 2 {
+		t.Errorf("GetLocalAddresses(kube-ipvs0) = %v, want {1.2.3.4, 1.2.3.5}", addrs.List())
+	}
+}
+
+func TestFakeGetAllLocalAddressesExcept(t *testing.T) {
+	fake := NewFakeNetlinkHandle(false)
+	fake.LocalAddresses["kube-ipvs0"] = []string{"1.2.3.4"}
+	fake.LocalAddresses["eth0"] = []string{"10.0.0.1"}
+
+	addrs, err := fake.GetAllLocalAddressesExcept("kube-ipvs0")
+	if err != nil {
+		t.Fatalf("GetAllLocalAddressesExcept returned error: %v", err)
+	}
+	if !addrs.HasAll("10.0.0.1") || addrs.Len() != 1 {
+		t.Errorf("GetAllLocalAddressesExcept(kube-ipvs0) = %v, want {10.0.0.1}", addrs.List())
+	}
+}
+
+func TestFakeEnsureAddressesBind(t *testing.T) {
+	fake := NewFakeNetlinkHandle(false)
+	fake.LocalAddresses["kube-ipvs0"] = []string{"1.2.3.4"}
+
+	existing, err := fake.EnsureAddressesBind([]string{"1.2.3.4", "1.2.3.5"}, "kube-ipvs0")
+	if err != nil {
+		t.Fatalf("EnsureAddressesBind returned error: %v", err)
+	}
+	if !existing.HasAll("1.2.3.4") || existing.Len() != 1 {
+		t.Errorf("EnsureAddressesBind existing = %v, want {1.2.3.4}", existing.List())
+	}
+	bound, err := fake.ListBoundAddresses("kube-ipvs0")
+	if err != nil {
+		t.Fatalf("ListBoundAddresses returned error: %v", err)
+	}
+	if !bound.HasAll("1.2.3.4", "1.2.3.5") || bound.Len() != 2 {
+		t.Errorf("ListBoundAddresses(kube-ipvs0) = %v, want {1.2.3.4, 1.2.3.5}", bound.List())
+	}
+}